@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	mathrand "math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// canSignHTTPExchangesOID is the X.509 extension
+// (draft-yasskin-http-origin-signed-responses §4.2) a CA must stamp onto a
+// leaf certificate, critical and with an ASN.1 NULL value, for it to be
+// usable for signing HTTP exchanges.
+var canSignHTTPExchangesOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 1, 22}
+
+// RetryBackoff computes how long to wait before attempt n (1-indexed) of a
+// request to the ACME server, given the request and the response (nil if
+// the previous attempt didn't get one). It matches the signature of
+// acme.Client.RetryBackoff, so a caller can override the schedule
+// acmeProvisioner uses without reaching into the underlying ACME client.
+// The ACME client itself already limits retries to 5xx, 429, and
+// bad-nonce 400 responses; RetryBackoff only controls how long to wait
+// between them.
+type RetryBackoff func(n int, req *http.Request, resp *http.Response) time.Duration
+
+// defaultACMERetryBackoff implements a truncated exponential backoff with
+// a ~10s ceiling and up to 1s of jitter, honoring a Retry-After header
+// when the server sent one.
+func defaultACMERetryBackoff(n int, req *http.Request, resp *http.Response) time.Duration {
+	if resp != nil {
+		if v := resp.Header.Get("Retry-After"); v != "" {
+			if secs, err := strconv.Atoi(v); err == nil {
+				return time.Duration(secs) * time.Second
+			}
+		}
+	}
+	const ceiling = 10 * time.Second
+	d := time.Duration(1<<uint(n)) * 100 * time.Millisecond
+	if d > ceiling {
+		d = ceiling
+	}
+	return d + time.Duration(mathrand.Int63n(int64(time.Second)))
+}
+
+// ChallengeSolver lets a caller plug in how gen-signedexchange proves
+// control of the domain being issued for. Present is called once the
+// challenge's key authorization is ready; CleanUp is always called
+// afterward, whether or not the challenge succeeded.
+type ChallengeSolver interface {
+	Present(ctx context.Context, domain, token, keyAuth string) error
+	CleanUp(ctx context.Context, domain, token string) error
+}
+
+// httpSolver is the default ChallengeSolver: it satisfies an http-01
+// challenge by writing the key authorization under
+// <WebRoot>/.well-known/acme-challenge/<token>, assuming the origin's own
+// web server serves WebRoot over HTTP on port 80 for the domain being
+// validated.
+type httpSolver struct {
+	WebRoot string
+}
+
+func (s *httpSolver) challengePath(token string) string {
+	return filepath.Join(s.WebRoot, ".well-known", "acme-challenge", token)
+}
+
+func (s *httpSolver) Present(ctx context.Context, domain, token, keyAuth string) error {
+	if err := os.MkdirAll(filepath.Dir(s.challengePath(token)), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.challengePath(token), []byte(keyAuth), 0644)
+}
+
+func (s *httpSolver) CleanUp(ctx context.Context, domain, token string) error {
+	return os.Remove(s.challengePath(token))
+}
+
+// provisionedCert is what acmeProvisioner.Provision returns (and caches):
+// a certificate chain capable of signing HTTP exchanges, its private key,
+// and an OCSP staple for the leaf.
+type provisionedCert struct {
+	Certs        []*x509.Certificate
+	Key          crypto.Signer
+	OCSPResponse []byte
+}
+
+// acmeProvisioner issues an SXG-compatible certificate via ACME v2 instead
+// of requiring -certificate/-privateKey on disk, caching the result so
+// repeated invocations don't hit the ACME server unnecessarily.
+type acmeProvisioner struct {
+	DirectoryURL string
+	Email        string
+	Solver       ChallengeSolver
+	CacheDir     string
+
+	// RetryBackoff overrides the schedule used for retried requests to the
+	// ACME server; nil uses defaultACMERetryBackoff.
+	RetryBackoff RetryBackoff
+}
+
+func (p *acmeProvisioner) retryBackoff() RetryBackoff {
+	if p.RetryBackoff != nil {
+		return p.RetryBackoff
+	}
+	return defaultACMERetryBackoff
+}
+
+// Provision returns a certificate chain and key for domain, reusing a
+// still-valid cached one from p.CacheDir if present, and otherwise issuing
+// a fresh one via ACME.
+func (p *acmeProvisioner) Provision(ctx context.Context, domain string) (*provisionedCert, error) {
+	if cached, ok := p.loadCache(domain); ok {
+		return cached, nil
+	}
+
+	accountKey, err := p.loadOrCreateAccountKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ACME account key: %v", err)
+	}
+	client := &acme.Client{
+		Key:          accountKey,
+		DirectoryURL: p.DirectoryURL,
+		RetryBackoff: p.retryBackoff(),
+	}
+
+	account := &acme.Account{Contact: []string{"mailto:" + p.Email}}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && err != acme.ErrAccountAlreadyExists {
+		return nil, fmt.Errorf("failed to register ACME account: %v", err)
+	}
+
+	order, err := client.AuthorizeOrder(ctx, []acme.AuthzID{{Type: "dns", Value: domain}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ACME order: %v", err)
+	}
+	for _, authzURL := range order.AuthzURLs {
+		if err := p.solveAuthorization(ctx, client, authzURL, domain); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, fmt.Errorf("ACME order did not become ready: %v", err)
+	}
+
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate certificate key: %v", err)
+	}
+	csrDER, err := createSXGCertificateRequest(certKey, domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate request: %v", err)
+	}
+	derChain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csrDER, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to finalize ACME order: %v", err)
+	}
+	certs, err := parseCertChain(derChain)
+	if err != nil {
+		return nil, err
+	}
+
+	ocspResp, err := fetchOCSPResponse(certs)
+	if err != nil {
+		log.Printf("warning: issued a certificate via ACME but failed to fetch an initial OCSP staple: %v", err)
+	}
+
+	result := &provisionedCert{Certs: certs, Key: certKey, OCSPResponse: ocspResp}
+	if err := p.saveCache(domain, result); err != nil {
+		log.Printf("warning: failed to cache the issued certificate: %v", err)
+	}
+	return result, nil
+}
+
+// solveAuthorization drives a single ACME authorization through its
+// http-01 challenge, using p.Solver, until it's valid.
+func (p *acmeProvisioner) solveAuthorization(ctx context.Context, client *acme.Client, authzURL, domain string) error {
+	authz, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch ACME authorization: %v", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var chal *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "http-01" {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("no http-01 challenge offered for %s", domain)
+	}
+
+	keyAuth, err := client.HTTP01ChallengeResponse(chal.Token)
+	if err != nil {
+		return fmt.Errorf("failed to compute challenge response: %v", err)
+	}
+	if err := p.Solver.Present(ctx, domain, chal.Token, keyAuth); err != nil {
+		return fmt.Errorf("failed to present http-01 challenge: %v", err)
+	}
+	defer p.Solver.CleanUp(ctx, domain, chal.Token)
+
+	if _, err := client.Accept(ctx, chal); err != nil {
+		return fmt.Errorf("failed to accept http-01 challenge: %v", err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authzURL); err != nil {
+		return fmt.Errorf("ACME authorization for %s did not become valid: %v", domain, err)
+	}
+	return nil
+}
+
+// createSXGCertificateRequest builds a CSR for domain carrying the
+// CanSignHttpExchanges extension.
+func createSXGCertificateRequest(key crypto.Signer, domain string) ([]byte, error) {
+	tmpl := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domain},
+		DNSNames: []string{domain},
+		ExtraExtensions: []pkix.Extension{{
+			Id:       canSignHTTPExchangesOID,
+			Critical: true,
+			// The CanSignHttpExchanges extension carries no information of
+			// its own; its extnValue is the DER encoding of ASN.1 NULL.
+			// x509.CreateCertificateRequest wraps Value in the extension's
+			// OCTET STRING itself, so Value holds only this inner encoding,
+			// not an OCTET STRING around it.
+			Value: []byte{0x05, 0x00},
+		}},
+	}
+	return x509.CreateCertificateRequest(rand.Reader, tmpl, key)
+}
+
+func parseCertChain(derChain [][]byte) ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, 0, len(derChain))
+	for _, der := range derChain {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse issued certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+func (p *acmeProvisioner) accountKeyPath() string {
+	return filepath.Join(p.CacheDir, "account.key.pem")
+}
+
+func (p *acmeProvisioner) cachePaths(domain string) (certPath, keyPath, ocspPath string) {
+	base := filepath.Join(p.CacheDir, domain)
+	return base + ".cert.pem", base + ".key.pem", base + ".ocsp.der"
+}
+
+// loadOrCreateAccountKey reuses the ACME account key cached from a
+// previous run, or generates and caches a new one.
+func (p *acmeProvisioner) loadOrCreateAccountKey() (*ecdsa.PrivateKey, error) {
+	if der, err := ioutil.ReadFile(p.accountKeyPath()); err == nil {
+		block, _ := pem.Decode(der)
+		if block == nil {
+			return nil, fmt.Errorf("invalid PEM in cached account key %q", p.accountKeyPath())
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(p.CacheDir, 0700); err != nil {
+		return nil, err
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	if err := ioutil.WriteFile(p.accountKeyPath(), pemBytes, 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// loadCache returns the cached certificate/key/OCSP staple for domain, if
+// one exists and the certificate isn't near expiry.
+func (p *acmeProvisioner) loadCache(domain string) (*provisionedCert, bool) {
+	certPath, keyPath, ocspPath := p.cachePaths(domain)
+
+	certPEM, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return nil, false
+	}
+	var certs []*x509.Certificate
+	for rest := certPEM; len(rest) > 0; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, false
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 || time.Until(certs[0].NotAfter) < 24*time.Hour {
+		return nil, false
+	}
+
+	keyPEM, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, false
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, false
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, false
+	}
+
+	// The OCSP staple is refreshed independently of the certificate, and
+	// is allowed to be absent from the cache.
+	ocspResp, _ := ioutil.ReadFile(ocspPath)
+
+	return &provisionedCert{Certs: certs, Key: key, OCSPResponse: ocspResp}, true
+}
+
+func (p *acmeProvisioner) saveCache(domain string, c *provisionedCert) error {
+	if err := os.MkdirAll(p.CacheDir, 0700); err != nil {
+		return err
+	}
+	certPath, keyPath, ocspPath := p.cachePaths(domain)
+
+	var certPEM []byte
+	for _, cert := range c.Certs {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	if err := ioutil.WriteFile(certPath, certPEM, 0644); err != nil {
+		return err
+	}
+
+	der, err := x509.MarshalECPrivateKey(c.Key.(*ecdsa.PrivateKey))
+	if err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	if err := ioutil.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return err
+	}
+
+	if len(c.OCSPResponse) > 0 {
+		if err := ioutil.WriteFile(ocspPath, c.OCSPResponse, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
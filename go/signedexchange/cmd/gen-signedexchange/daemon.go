@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/WICG/webpackage/go/signedexchange"
+	"github.com/WICG/webpackage/go/signedexchange/version"
+)
+
+// signerConfig holds the parts of a signer's setup that stay the same
+// across exchanges: where its certificate and key come from, and the URLs
+// it signs against. It's read once from flags, whether run() signs a
+// single exchange or starts a daemon.
+type signerConfig struct {
+	certificatePath string
+	privateKeyPath  string
+	certUrl         *url.URL
+	validityUrl     *url.URL
+}
+
+// daemon holds a signer's resident certificate chain, private key, and
+// OCSP staple, so a server started with -serve can sign many exchanges
+// without re-parsing PEM files between requests. Its methods implement the
+// Cmd* commands in protocol.go. A one-shot, non-daemon run() loads its
+// certificate chain, key, and staples through a daemon too, but builds and
+// signs its exchange itself rather than through signExchange.
+type daemon struct {
+	config signerConfig
+
+	mu       sync.RWMutex
+	certs    []*x509.Certificate
+	privkey  crypto.PrivateKey
+	ocspResp []byte
+	sctList  []byte
+}
+
+// newDaemon builds a daemon and performs its initial certificate/key load
+// from config.certificatePath/privateKeyPath.
+func newDaemon(config signerConfig, ocspResp, sctList []byte) (*daemon, error) {
+	d := &daemon{config: config, ocspResp: ocspResp, sctList: sctList}
+	if err := d.reloadCerts(config.certificatePath, config.privateKeyPath); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// newProvisionedDaemon builds a daemon around a certificate chain and key
+// obtained some other way than reading config.certificatePath/
+// privateKeyPath from disk, e.g. via ACME. CmdReloadCerts on such a daemon
+// re-reads whichever certificate and key files its request names; it does
+// not re-provision a certificate via ACME.
+func newProvisionedDaemon(config signerConfig, certs []*x509.Certificate, privkey crypto.PrivateKey, ocspResp, sctList []byte) *daemon {
+	return &daemon{config: config, certs: certs, privkey: privkey, ocspResp: ocspResp, sctList: sctList}
+}
+
+// reloadCerts re-reads the certificate chain and private key from disk,
+// replacing the daemon's resident ones. It backs both run()'s initial load
+// and the CmdReloadCerts command.
+func (d *daemon) reloadCerts(certificatePath, privateKeyPath string) error {
+	certtext, err := ioutil.ReadFile(certificatePath)
+	if err != nil {
+		return fmt.Errorf("failed to read certificate file %q. err: %v", certificatePath, err)
+	}
+	certs, err := signedexchange.ParseCertificates(certtext)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate file %q. err: %v", certificatePath, err)
+	}
+
+	privkeytext, err := ioutil.ReadFile(privateKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read private key file %q. err: %v", privateKeyPath, err)
+	}
+	var privkey crypto.PrivateKey
+	for {
+		var pemBlock *pem.Block
+		pemBlock, privkeytext = pem.Decode(privkeytext)
+		if pemBlock == nil {
+			return fmt.Errorf("invalid PEM block in private key file %q.", privateKeyPath)
+		}
+
+		privkey, err = signedexchange.ParsePrivateKey(pemBlock.Bytes)
+		if err == nil || len(privkeytext) == 0 {
+			break
+		}
+		// Else try next PEM block.
+	}
+	if privkey == nil {
+		return fmt.Errorf("failed to parse private key file %q.", privateKeyPath)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.config.certificatePath, d.config.privateKeyPath = certificatePath, privateKeyPath
+	d.certs, d.privkey = certs, privkey
+	return nil
+}
+
+// refreshOCSP re-fetches the OCSP response stapled for the leaf
+// certificate from its issuer's AIA OCSP responder.
+func (d *daemon) refreshOCSP() error {
+	d.mu.RLock()
+	certs := d.certs
+	d.mu.RUnlock()
+
+	ocspResp, err := fetchOCSPResponse(certs)
+	if err != nil {
+		return fmt.Errorf("failed to fetch OCSP response. err: %v", err)
+	}
+
+	d.mu.Lock()
+	d.ocspResp = ocspResp
+	d.mu.Unlock()
+	return nil
+}
+
+// health reports whether the daemon has a certificate loaded and ready to
+// sign with.
+func (d *daemon) health() *healthResponse {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if len(d.certs) == 0 {
+		return &healthResponse{}
+	}
+	return &healthResponse{
+		certsLoaded:  true,
+		certNotAfter: d.certs[0].NotAfter.Format(time.RFC3339),
+	}
+}
+
+// certChain returns the daemon's resident certificate chain and its
+// current OCSP/SCT staples, for writing a cert-chain+cbor document
+// alongside a signed exchange.
+func (d *daemon) certChain() (certs []*x509.Certificate, ocspResp, sctList []byte) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.certs, d.ocspResp, d.sctList
+}
+
+// signExchange builds and signs one HTTP exchange from req, using the
+// daemon's resident certificate chain and private key.
+func (d *daemon) signExchange(req *signExchangeRequest) (*signExchangeResponse, error) {
+	d.mu.RLock()
+	certs, privkey := d.certs, d.privkey
+	d.mu.RUnlock()
+
+	parsedUrl, err := url.Parse(req.uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URI %q. err: %v", req.uri, err)
+	}
+	ver, ok := version.Parse(req.version)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse version %q", req.version)
+	}
+
+	resHeader := req.responseHeader
+	if resHeader.Get("content-type") == "" {
+		resHeader.Add("content-type", "text/html; charset=utf-8")
+	}
+	e, err := signedexchange.NewExchange(parsedUrl, req.requestHeader, req.responseStatus, resHeader, req.content)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.MiEncodePayload(req.miRecordSize, ver); err != nil {
+		return nil, err
+	}
+
+	var date time.Time
+	if req.date == "" {
+		date = time.Now()
+	} else if date, err = time.Parse(time.RFC3339, req.date); err != nil {
+		return nil, err
+	}
+	expire := 1 * time.Hour
+	if req.expire != "" {
+		if expire, err = time.ParseDuration(req.expire); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &signedexchange.Signer{
+		Date:        date,
+		Expires:     date.Add(expire),
+		Certs:       certs,
+		CertUrl:     d.config.certUrl,
+		ValidityUrl: d.config.validityUrl,
+		PrivKey:     privkey,
+	}
+	if err := e.AddSignatureHeader(s, ver); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := e.Write(&buf, ver); err != nil {
+		return nil, fmt.Errorf("failed to write exchange. err: %v", err)
+	}
+	return &signExchangeResponse{exchange: buf.Bytes()}, nil
+}
@@ -1,8 +1,7 @@
 package main
 
 import (
-	"crypto"
-	"encoding/pem"
+	"context"
 	"flag"
 	"fmt"
 	"io"
@@ -46,6 +45,19 @@ var (
 	flagDumpHeadersCbor      = flag.String("dumpHeadersCbor", "", "Dump metadata and headers encoded as a canonical CBOR to a file for debugging.")
 	flagOutput               = flag.String("o", "out.sxg", "Signed exchange output file")
 
+	flagOCSP            = flag.String("ocsp", "", "OCSP response file for the leaf certificate, to staple into the cert-chain CBOR")
+	flagSCT             = flag.String("sct", "", "SCT list file for the leaf certificate, to embed in the cert-chain CBOR")
+	flagFetchOCSP       = flag.Bool("fetchOCSP", false, "Fetch a fresh OCSP response for the leaf certificate from its issuer's AIA OCSP responder, instead of reading -ocsp")
+	flagCertChainOutput = flag.String("certChainOutput", "", "Cert-chain CBOR output file; defaults to the -o output file with its extension replaced by .cert.cbor")
+
+	flagACME          = flag.Bool("acme", false, "Provision the certificate via ACME instead of reading -certificate/-privateKey")
+	flagACMEDirectory = flag.String("acmeDirectoryURL", "https://acme-v02.api.letsencrypt.org/directory", "ACME directory URL to request the certificate from")
+	flagACMEEmail     = flag.String("acmeEmail", "", "Contact email to register the ACME account with")
+	flagACMECacheDir  = flag.String("acmeCacheDir", ".acme-cache", "Directory to cache the ACME account key and issued certificate/OCSP staple in, to avoid re-provisioning on every run")
+	flagACMEWebRoot   = flag.String("acmeWebRoot", ".", "Document root the origin serves over HTTP, used by the default http-01 challenge solver to publish challenge responses")
+
+	flagServe = flag.String("serve", "", "Run as a long-lived signer daemon listening on this address (unix:///path/to.sock or [host]:port) instead of signing -content once and exiting")
+
 	flagRequestHeader  = headerArgs{}
 	flagResponseHeader = headerArgs{}
 )
@@ -55,59 +67,104 @@ func init() {
 	flag.Var(&flagResponseHeader, "responseHeader", "Response header arguments")
 }
 
-func run() error {
-	payload, err := ioutil.ReadFile(*flagContent)
+// buildDaemon loads the certificate chain, private key, and OCSP staple
+// named by the -certificate/-privateKey/-acme* flags (resolving domain
+// from uri when provisioning via ACME) and wraps them in a daemon, shared
+// by both a one-shot run() and -serve.
+func buildDaemon(uri string) (*daemon, error) {
+	certUrl, err := url.Parse(*flagCertificateUrl)
 	if err != nil {
-		return fmt.Errorf("failed to read content from payload source file \"%s\". err: %v", *flagContent, err)
+		return nil, fmt.Errorf("failed to parse certificate URL %q. err: %v", *flagCertificateUrl, err)
 	}
-
-	certtext, err := ioutil.ReadFile(*flagCertificate)
+	validityUrl, err := url.Parse(*flagValidityUrl)
 	if err != nil {
-		return fmt.Errorf("failed to read certificate file %q. err: %v", *flagCertificate, err)
+		return nil, fmt.Errorf("failed to parse validity URL %q. err: %v", *flagValidityUrl, err)
+	}
+	config := signerConfig{
+		certificatePath: *flagCertificate,
+		privateKeyPath:  *flagPrivateKey,
+		certUrl:         certUrl,
+		validityUrl:     validityUrl,
+	}
 
+	var sctList []byte
+	if *flagSCT != "" {
+		sctList, err = ioutil.ReadFile(*flagSCT)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SCT file %q. err: %v", *flagSCT, err)
+		}
 	}
-	certs, err := signedexchange.ParseCertificates(certtext)
+
+	if *flagACME {
+		parsedUrl, err := url.Parse(uri)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse URL %q. err: %v", uri, err)
+		}
+		provisioner := &acmeProvisioner{
+			DirectoryURL: *flagACMEDirectory,
+			Email:        *flagACMEEmail,
+			Solver:       &httpSolver{WebRoot: *flagACMEWebRoot},
+			CacheDir:     *flagACMECacheDir,
+		}
+		provisioned, err := provisioner.Provision(context.Background(), parsedUrl.Hostname())
+		if err != nil {
+			return nil, fmt.Errorf("failed to provision a certificate via ACME: %v", err)
+		}
+		return newProvisionedDaemon(config, provisioned.Certs, provisioned.Key, provisioned.OCSPResponse, sctList), nil
+	}
+
+	d, err := newDaemon(config, nil, sctList)
 	if err != nil {
-		return fmt.Errorf("failed to parse certificate file %q. err: %v", *flagCertificate, err)
+		return nil, err
+	}
+	switch {
+	case *flagFetchOCSP:
+		if err := d.refreshOCSP(); err != nil {
+			return nil, err
+		}
+	case *flagOCSP != "":
+		ocspResp, err := ioutil.ReadFile(*flagOCSP)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read OCSP response file %q. err: %v", *flagOCSP, err)
+		}
+		d.ocspResp = ocspResp
+	default:
+		log.Print("warning: no OCSP response given (-ocsp, -fetchOCSP, or -acme); most SXG-consuming browsers will reject the exchange")
 	}
+	return d, nil
+}
 
-	certUrl, err := url.Parse(*flagCertificateUrl)
+func run() error {
+	if *flagServe != "" {
+		d, err := buildDaemon(*flagUri)
+		if err != nil {
+			return err
+		}
+		return runServer(*flagServe, d)
+	}
+
+	payload, err := ioutil.ReadFile(*flagContent)
 	if err != nil {
-		return fmt.Errorf("failed to parse certificate URL %q. err: %v", *flagCertificateUrl, err)
+		return fmt.Errorf("failed to read content from payload source file \"%s\". err: %v", *flagContent, err)
 	}
-	validityUrl, err := url.Parse(*flagValidityUrl)
+
+	parsedUrl, err := url.Parse(*flagUri)
 	if err != nil {
-		return fmt.Errorf("failed to parse validity URL %q. err: %v", *flagValidityUrl, err)
+		return fmt.Errorf("failed to parse URL %q. err: %v", *flagUri, err)
 	}
 
-	privkeytext, err := ioutil.ReadFile(*flagPrivateKey)
+	d, err := buildDaemon(*flagUri)
 	if err != nil {
-		return fmt.Errorf("failed to read private key file %q. err: %v", *flagPrivateKey, err)
+		return err
 	}
+	certs, ocspResp, sctList := d.certChain()
+	privkey := d.privkey
+
 	ver, ok := version.Parse(*flagVersion)
 	if !ok {
 		return fmt.Errorf("failed to parse version %q", *flagVersion)
 	}
 
-	var privkey crypto.PrivateKey
-	for {
-		var pemBlock *pem.Block
-		pemBlock, privkeytext = pem.Decode(privkeytext)
-		if pemBlock == nil {
-			return fmt.Errorf("invalid PEM block in private key file %q.", *flagPrivateKey)
-		}
-
-		var err error
-		privkey, err = signedexchange.ParsePrivateKey(pemBlock.Bytes)
-		if err == nil || len(privkeytext) == 0 {
-			break
-		}
-		// Else try next PEM block.
-	}
-	if privkey == nil {
-		return fmt.Errorf("failed to parse private key file %q.", *flagPrivateKey)
-	}
-
 	var fMsg io.WriteCloser
 	if *flagDumpSignatureMessage != "" {
 		var err error
@@ -133,11 +190,6 @@ func run() error {
 	}
 	defer f.Close()
 
-	parsedUrl, err := url.Parse(*flagUri)
-	if err != nil {
-		return fmt.Errorf("failed to parse URL %q. err: %v", *flagUri, err)
-	}
-
 	reqHeader := http.Header{}
 	for _, h := range flagRequestHeader {
 		chunks := strings.SplitN(h, ":", 2)
@@ -175,8 +227,8 @@ func run() error {
 		Date:        date,
 		Expires:     date.Add(*flagExpire),
 		Certs:       certs,
-		CertUrl:     certUrl,
-		ValidityUrl: validityUrl,
+		CertUrl:     d.config.certUrl,
+		ValidityUrl: d.config.validityUrl,
 		PrivKey:     privkey,
 	}
 	if err := e.AddSignatureHeader(s, ver); err != nil {
@@ -196,6 +248,19 @@ func run() error {
 	if err := e.Write(f, ver); err != nil {
 		return fmt.Errorf("failed to write exchange. err: %v", err)
 	}
+
+	certChainPath := *flagCertChainOutput
+	if certChainPath == "" {
+		certChainPath = defaultCertChainPath(*flagOutput)
+	}
+	fCertChain, err := os.Create(certChainPath)
+	if err != nil {
+		return fmt.Errorf("failed to open cert-chain output file %q for writing. err: %v", certChainPath, err)
+	}
+	defer fCertChain.Close()
+	if err := writeCertChain(fCertChain, certs, ocspResp, sctList); err != nil {
+		return fmt.Errorf("failed to write cert-chain CBOR to %q. err: %v", certChainPath, err)
+	}
 	return nil
 }
 
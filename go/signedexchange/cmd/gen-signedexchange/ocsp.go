@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/WICG/webpackage/go/webpack/cbor"
+	"golang.org/x/crypto/ocsp"
+)
+
+// certChainMagic is the preamble required at the start of a
+// cert-chain+cbor document (draft-yasskin-http-origin-signed-responses
+// §3.3): the CBOR text string "📜⛓".
+const certChainMagic = "\U0001F4DC⛓"
+
+// ocspHTTPClient is the http.Client used to fetch OCSP responses. It's a
+// package variable, rather than a value run() constructs inline, so a
+// caller embedding this as a library can swap in a client with a custom
+// transport or timeout.
+var ocspHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// ocspMaxAttempts bounds how many attempts, the first one included,
+// fetchOCSPResponse makes at a request to the OCSP responder before giving
+// up.
+const ocspMaxAttempts = 4
+
+// fetchOCSPResponse requests a fresh OCSP response for certs[0] (the leaf)
+// from the issuer certs[1]'s AIA OCSP responder, verifies the response is
+// signed for that certificate, and returns its raw DER bytes.
+func fetchOCSPResponse(certs []*x509.Certificate) ([]byte, error) {
+	if len(certs) < 2 {
+		return nil, fmt.Errorf("need a leaf certificate and its issuer to build an OCSP request")
+	}
+	leaf, issuer := certs[0], certs[1]
+	if len(leaf.OCSPServer) == 0 {
+		return nil, fmt.Errorf("leaf certificate has no OCSP responder URI (Authority Information Access)")
+	}
+
+	reqDER, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build OCSP request: %v", err)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < ocspMaxAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(ocspRetryBackoff(attempt))
+		}
+		respDER, err := postOCSPRequest(leaf.OCSPServer[0], reqDER)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		parsed, err := ocsp.ParseResponseForCert(respDER, leaf, issuer)
+		if err != nil {
+			lastErr = fmt.Errorf("failed to verify OCSP response: %v", err)
+			continue
+		}
+		if parsed.Status != ocsp.Good {
+			return nil, fmt.Errorf("OCSP responder reports certificate status %d, not good", parsed.Status)
+		}
+		return respDER, nil
+	}
+	return nil, fmt.Errorf("giving up after %d attempts fetching OCSP response: %v", ocspMaxAttempts, lastErr)
+}
+
+// postOCSPRequest issues a single OCSP HTTP request to uri and returns the
+// raw response body.
+func postOCSPRequest(uri string, reqDER []byte) ([]byte, error) {
+	req, err := http.NewRequest("POST", uri, bytes.NewReader(reqDER))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+
+	resp, err := ocspHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OCSP responder %q returned HTTP %d", uri, resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// ocspRetryBackoff returns how long to wait before retry number attempt
+// (1-indexed) of an OCSP fetch.
+func ocspRetryBackoff(attempt int) time.Duration {
+	return time.Duration(attempt) * 500 * time.Millisecond
+}
+
+// writeCertChain writes certs (leaf first, then its issuers) as a
+// cert-chain+cbor document to w, embedding ocspResp and sctList (either
+// may be nil) as the "ocsp" and "sct" fields of the leaf certificate's
+// entry, as required for an SXG-consuming browser to accept the exchange.
+func writeCertChain(w io.Writer, certs []*x509.Certificate, ocspResp, sctList []byte) error {
+	top := cbor.New(w)
+	top.Canonical = true
+	arr := top.AppendArray(uint64(1 + len(certs)))
+	arr.AppendUTF8S(certChainMagic)
+	for i, cert := range certs {
+		fields := map[string][]byte{"cert": cert.Raw}
+		if i == 0 {
+			if len(sctList) > 0 {
+				fields["sct"] = sctList
+			}
+			if len(ocspResp) > 0 {
+				fields["ocsp"] = ocspResp
+			}
+		}
+		arr.AppendCanonicalMapBytes(fields)
+	}
+	arr.Finish()
+	return top.Finish()
+}
+
+// defaultCertChainPath derives a cert-chain CBOR output path alongside the
+// main .sxg output file, replacing its extension with ".cert.cbor".
+func defaultCertChainPath(output string) string {
+	return strings.TrimSuffix(output, filepath.Ext(output)) + ".cert.cbor"
+}
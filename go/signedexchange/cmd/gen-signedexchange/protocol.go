@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/WICG/webpackage/go/webpack/cbor"
+)
+
+// Command identifies the kind of request a client sends to a signer
+// daemon started with -serve. Each Command has a corresponding request and
+// response payload shape, described alongside its encode/decode functions
+// below.
+type Command uint64
+
+const (
+	// CmdSignExchange signs one HTTP exchange and streams back the
+	// resulting .sxg bytes.
+	CmdSignExchange Command = iota + 1
+	// CmdRefreshOCSP re-fetches the OCSP response stapled for the leaf
+	// certificate, without reloading the certificate or key.
+	CmdRefreshOCSP
+	// CmdHealth reports whether the daemon has a certificate and key
+	// loaded and ready to sign with.
+	CmdHealth
+	// CmdReloadCerts re-reads the certificate chain and private key from
+	// disk, picking up a renewed certificate without restarting the
+	// daemon.
+	CmdReloadCerts
+)
+
+// frame is one request or response exchanged over a connection: a command,
+// a request ID a client uses to match an out-of-order response to its
+// request, and the command's CBOR-encoded payload. Requests and responses
+// share this envelope; what's inside payload depends on command (and, for
+// a response, whether err is empty).
+type frame struct {
+	command Command
+	id      uint64
+	err     string
+	payload []byte
+}
+
+// writeFrame CBOR-encodes f as an array [command, id, err, payload] and
+// writes it to w. payload is carried as an opaque byte string so a reader
+// can dispatch on command and id before decoding it.
+func writeFrame(w io.Writer, f frame) error {
+	top := cbor.New(w)
+	arr := top.AppendArray(4)
+	arr.AppendUint64(uint64(f.command))
+	arr.AppendUint64(f.id)
+	arr.AppendUTF8S(f.err)
+	arr.AppendBytes(f.payload)
+	arr.Finish()
+	return top.Finish()
+}
+
+// readFrame decodes one frame written by writeFrame from d. d is shared
+// across every frame read from a connection, so readFrame resets it first:
+// without that, Next would return io.EOF forever after the first frame,
+// since a Decoder otherwise expects to decode exactly one top-level item
+// per reader.
+func readFrame(d *cbor.Decoder) (frame, error) {
+	d.Reset()
+	var f frame
+	ev, err := d.Next()
+	if err != nil {
+		return f, err
+	}
+	if ev.Type != cbor.TypeArray || ev.Uint != 4 {
+		return f, fmt.Errorf("signer protocol: expected a 4-element frame array, got %v of size %d", ev.Type, ev.Uint)
+	}
+	if ev, err = d.Next(); err != nil {
+		return f, err
+	}
+	f.command = Command(ev.Uint)
+	if ev, err = d.Next(); err != nil {
+		return f, err
+	}
+	f.id = ev.Uint
+	if ev, err = d.Next(); err != nil {
+		return f, err
+	}
+	f.err = string(ev.Bytes)
+	if ev, err = d.Next(); err != nil {
+		return f, err
+	}
+	f.payload = ev.Bytes
+	if ev, err = d.Next(); err != nil {
+		return f, err
+	}
+	if !ev.End {
+		return f, fmt.Errorf("signer protocol: expected end of frame array")
+	}
+	return f, nil
+}
+
+// signExchangeRequest is the payload of a CmdSignExchange request: enough
+// to build and sign one exchange, mirroring the per-exchange flags run()
+// reads from the command line.
+type signExchangeRequest struct {
+	uri            string
+	version        string
+	responseStatus int
+	content        []byte
+	requestHeader  http.Header
+	responseHeader http.Header
+	miRecordSize   int
+	date           string // RFC3339, or "" for time.Now()
+	expire         string // time.ParseDuration syntax
+}
+
+func encodeHeader(arr *cbor.Array, h http.Header) {
+	var n uint64
+	for _, vs := range h {
+		n += uint64(len(vs))
+	}
+	pairs := arr.AppendArray(n)
+	for name, vs := range h {
+		for _, v := range vs {
+			pair := pairs.AppendArray(2)
+			pair.AppendUTF8S(name)
+			pair.AppendUTF8S(v)
+			pair.Finish()
+		}
+	}
+	pairs.Finish()
+}
+
+func decodeHeader(d *cbor.Decoder) (http.Header, error) {
+	ev, err := d.Next()
+	if err != nil {
+		return nil, err
+	}
+	if ev.Type != cbor.TypeArray {
+		return nil, fmt.Errorf("signer protocol: expected a header array")
+	}
+	h := http.Header{}
+	for i := uint64(0); i < ev.Uint; i++ {
+		if ev, err = d.Next(); err != nil || ev.Type != cbor.TypeArray || ev.Uint != 2 {
+			return nil, fmt.Errorf("signer protocol: expected a 2-element [name, value] pair")
+		}
+		name, err := decodeText(d)
+		if err != nil {
+			return nil, err
+		}
+		value, err := decodeText(d)
+		if err != nil {
+			return nil, err
+		}
+		if ev, err = d.Next(); err != nil || !ev.End {
+			return nil, fmt.Errorf("signer protocol: expected end of [name, value] pair")
+		}
+		h.Add(name, value)
+	}
+	if ev, err = d.Next(); err != nil || !ev.End {
+		return nil, fmt.Errorf("signer protocol: expected end of header array")
+	}
+	return h, nil
+}
+
+func decodeText(d *cbor.Decoder) (string, error) {
+	ev, err := d.Next()
+	if err != nil {
+		return "", err
+	}
+	if ev.Type != cbor.TypeText {
+		return "", fmt.Errorf("signer protocol: expected a text string, got %v", ev.Type)
+	}
+	return string(ev.Bytes), nil
+}
+
+// encodeSignExchangeRequest CBOR-encodes req as the payload of a
+// CmdSignExchange frame.
+func encodeSignExchangeRequest(req *signExchangeRequest) []byte {
+	var buf bytes.Buffer
+	top := cbor.New(&buf)
+	arr := top.AppendArray(9)
+	arr.AppendUTF8S(req.uri)
+	arr.AppendUTF8S(req.version)
+	arr.AppendInt64(int64(req.responseStatus))
+	arr.AppendBytes(req.content)
+	encodeHeader(arr, req.requestHeader)
+	encodeHeader(arr, req.responseHeader)
+	arr.AppendInt64(int64(req.miRecordSize))
+	arr.AppendUTF8S(req.date)
+	arr.AppendUTF8S(req.expire)
+	arr.Finish()
+	top.Finish()
+	return buf.Bytes()
+}
+
+func decodeSignExchangeRequest(payload []byte) (*signExchangeRequest, error) {
+	d := cbor.NewDecoder(bytes.NewReader(payload))
+	ev, err := d.Next()
+	if err != nil {
+		return nil, err
+	}
+	if ev.Type != cbor.TypeArray || ev.Uint != 9 {
+		return nil, fmt.Errorf("signer protocol: malformed SignExchange request")
+	}
+	req := &signExchangeRequest{}
+	if req.uri, err = decodeText(d); err != nil {
+		return nil, err
+	}
+	if req.version, err = decodeText(d); err != nil {
+		return nil, err
+	}
+	if ev, err = d.Next(); err != nil {
+		return nil, err
+	}
+	req.responseStatus = int(ev.Uint)
+	if ev, err = d.Next(); err != nil || ev.Type != cbor.TypeBytes {
+		return nil, fmt.Errorf("signer protocol: expected the exchange payload as a byte string")
+	}
+	req.content = ev.Bytes
+	if req.requestHeader, err = decodeHeader(d); err != nil {
+		return nil, err
+	}
+	if req.responseHeader, err = decodeHeader(d); err != nil {
+		return nil, err
+	}
+	if ev, err = d.Next(); err != nil {
+		return nil, err
+	}
+	req.miRecordSize = int(ev.Uint)
+	if req.date, err = decodeText(d); err != nil {
+		return nil, err
+	}
+	if req.expire, err = decodeText(d); err != nil {
+		return nil, err
+	}
+	if ev, err = d.Next(); err != nil || !ev.End {
+		return nil, fmt.Errorf("signer protocol: expected end of SignExchange request")
+	}
+	return req, nil
+}
+
+// signExchangeResponse is the payload of a successful CmdSignExchange
+// response: the signed exchange, ready to write straight to a .sxg file.
+type signExchangeResponse struct {
+	exchange []byte
+}
+
+func encodeSignExchangeResponse(resp *signExchangeResponse) []byte {
+	var buf bytes.Buffer
+	top := cbor.New(&buf)
+	arr := top.AppendArray(1)
+	arr.AppendBytes(resp.exchange)
+	arr.Finish()
+	top.Finish()
+	return buf.Bytes()
+}
+
+func decodeSignExchangeResponse(payload []byte) (*signExchangeResponse, error) {
+	d := cbor.NewDecoder(bytes.NewReader(payload))
+	ev, err := d.Next()
+	if err != nil {
+		return nil, err
+	}
+	if ev.Type != cbor.TypeArray || ev.Uint != 1 {
+		return nil, fmt.Errorf("signer protocol: malformed SignExchange response")
+	}
+	if ev, err = d.Next(); err != nil || ev.Type != cbor.TypeBytes {
+		return nil, fmt.Errorf("signer protocol: expected the signed exchange as a byte string")
+	}
+	resp := &signExchangeResponse{exchange: ev.Bytes}
+	if ev, err = d.Next(); err != nil || !ev.End {
+		return nil, fmt.Errorf("signer protocol: expected end of SignExchange response")
+	}
+	return resp, nil
+}
+
+// healthResponse is the payload of a CmdHealth response.
+type healthResponse struct {
+	certsLoaded  bool
+	certNotAfter string // RFC3339, or "" if certsLoaded is false
+}
+
+func encodeHealthResponse(resp *healthResponse) []byte {
+	var buf bytes.Buffer
+	top := cbor.New(&buf)
+	arr := top.AppendArray(2)
+	if resp.certsLoaded {
+		arr.AppendUint64(1)
+	} else {
+		arr.AppendUint64(0)
+	}
+	arr.AppendUTF8S(resp.certNotAfter)
+	arr.Finish()
+	top.Finish()
+	return buf.Bytes()
+}
+
+func decodeHealthResponse(payload []byte) (*healthResponse, error) {
+	d := cbor.NewDecoder(bytes.NewReader(payload))
+	ev, err := d.Next()
+	if err != nil {
+		return nil, err
+	}
+	if ev.Type != cbor.TypeArray || ev.Uint != 2 {
+		return nil, fmt.Errorf("signer protocol: malformed Health response")
+	}
+	resp := &healthResponse{}
+	if ev, err = d.Next(); err != nil {
+		return nil, err
+	}
+	resp.certsLoaded = ev.Uint != 0
+	if resp.certNotAfter, err = decodeText(d); err != nil {
+		return nil, err
+	}
+	if ev, err = d.Next(); err != nil || !ev.End {
+		return nil, fmt.Errorf("signer protocol: expected end of Health response")
+	}
+	return resp, nil
+}
+
+// reloadCertsRequest is the payload of a CmdReloadCerts request: the
+// certificate chain and private key files to re-read, replacing the
+// daemon's resident ones.
+type reloadCertsRequest struct {
+	certificatePath string
+	privateKeyPath  string
+}
+
+func encodeReloadCertsRequest(req *reloadCertsRequest) []byte {
+	var buf bytes.Buffer
+	top := cbor.New(&buf)
+	arr := top.AppendArray(2)
+	arr.AppendUTF8S(req.certificatePath)
+	arr.AppendUTF8S(req.privateKeyPath)
+	arr.Finish()
+	top.Finish()
+	return buf.Bytes()
+}
+
+func decodeReloadCertsRequest(payload []byte) (*reloadCertsRequest, error) {
+	d := cbor.NewDecoder(bytes.NewReader(payload))
+	ev, err := d.Next()
+	if err != nil {
+		return nil, err
+	}
+	if ev.Type != cbor.TypeArray || ev.Uint != 2 {
+		return nil, fmt.Errorf("signer protocol: malformed ReloadCerts request")
+	}
+	req := &reloadCertsRequest{}
+	if req.certificatePath, err = decodeText(d); err != nil {
+		return nil, err
+	}
+	if req.privateKeyPath, err = decodeText(d); err != nil {
+		return nil, err
+	}
+	if ev, err = d.Next(); err != nil || !ev.End {
+		return nil, fmt.Errorf("signer protocol: expected end of ReloadCerts request")
+	}
+	return req, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/WICG/webpackage/go/webpack/cbor"
+)
+
+// unixSocketPrefix marks a -serve address as a Unix domain socket path
+// rather than a TCP address, e.g. "unix:///var/run/gen-signedexchange.sock".
+const unixSocketPrefix = "unix://"
+
+// listen opens the listener a -serve address names: a Unix domain socket
+// for a "unix://" address, or TCP otherwise.
+func listen(addr string) (net.Listener, error) {
+	if strings.HasPrefix(addr, unixSocketPrefix) {
+		path := strings.TrimPrefix(addr, unixSocketPrefix)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove stale socket %q. err: %v", path, err)
+		}
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// runServer listens on addr and answers signing requests against d until
+// the listener fails (e.g. because the process is being shut down).
+func runServer(addr string, d *daemon) error {
+	l, err := listen(addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %q. err: %v", addr, err)
+	}
+	defer l.Close()
+	log.Printf("gen-signedexchange: serving on %s", addr)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go handleConn(conn, d)
+	}
+}
+
+// handleConn answers every request on conn, dispatching each to its own
+// goroutine so a slow CmdSignExchange can't hold up other requests
+// multiplexed onto the same connection. writeMu serializes writes to conn,
+// since frames from concurrent goroutines could otherwise interleave on
+// the wire.
+func handleConn(conn net.Conn, d *daemon) {
+	defer conn.Close()
+	dec := cbor.NewDecoder(conn)
+	var writeMu sync.Mutex
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		f, err := readFrame(dec)
+		if err != nil {
+			return
+		}
+		wg.Add(1)
+		go func(req frame) {
+			defer wg.Done()
+			resp := dispatch(d, req)
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			if err := writeFrame(conn, resp); err != nil {
+				log.Printf("gen-signedexchange: failed to write response: %v", err)
+			}
+		}(f)
+	}
+}
+
+// dispatch runs one request frame against d and builds its response frame,
+// carrying any error in the response's err field rather than tearing down
+// the connection.
+func dispatch(d *daemon, req frame) frame {
+	payload, err := runCommand(d, req)
+	if err != nil {
+		return frame{command: req.command, id: req.id, err: err.Error()}
+	}
+	return frame{command: req.command, id: req.id, payload: payload}
+}
+
+func runCommand(d *daemon, req frame) ([]byte, error) {
+	switch req.command {
+	case CmdSignExchange:
+		signReq, err := decodeSignExchangeRequest(req.payload)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := d.signExchange(signReq)
+		if err != nil {
+			return nil, err
+		}
+		return encodeSignExchangeResponse(resp), nil
+
+	case CmdRefreshOCSP:
+		if err := d.refreshOCSP(); err != nil {
+			return nil, err
+		}
+		return nil, nil
+
+	case CmdHealth:
+		return encodeHealthResponse(d.health()), nil
+
+	case CmdReloadCerts:
+		reloadReq, err := decodeReloadCertsRequest(req.payload)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.reloadCerts(reloadReq.certificatePath, reloadReq.privateKeyPath); err != nil {
+			return nil, err
+		}
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("signer protocol: unknown command %d", req.command)
+	}
+}
@@ -0,0 +1,733 @@
+package cbor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"unicode/utf8"
+)
+
+// TypeTag and TypeOther extend the Type vocabulary used by the write side
+// (TypePosInt, TypeNegInt, TypeBytes, TypeText, TypeArray, TypeMap) to the
+// two CBOR major types the encoder never needs to produce but the decoder
+// must recognize: tags (major type 6) and simple values/floats (major type
+// 7).
+const (
+	TypeTag   Type = 6 << 5
+	TypeOther Type = 7 << 5
+)
+
+// maxItemLength caps the length accepted for a single bytes/text item at
+// 4 GiB; a longer claimed length is rejected before anything is read.
+// Decoder allocates a buffer of the claimed length before reading the
+// payload.
+const maxItemLength = 1 << 32
+
+// Event is a single CBOR data item reported by Decoder.Next, or the closing
+// of an array/map opened by an earlier event.
+type Event struct {
+	// Type is the major type of this item: TypePosInt, TypeNegInt,
+	// TypeBytes, TypeText, TypeArray, TypeMap, or TypeOther. End events
+	// repeat the Type of the array/map they close.
+	Type Type
+
+	// End is true when this event closes the most recently opened
+	// TypeArray or TypeMap, rather than reporting a new item.
+	End bool
+
+	// Tags holds any tag numbers wrapping this item, outermost first; it's
+	// nil for an untagged item. A tag and the item it wraps form a single
+	// data item, so they're reported together rather than as separate
+	// events.
+	Tags []uint64
+
+	// Uint holds the decoded value for TypePosInt, or the element count
+	// for TypeArray/TypeMap. For TypeNegInt, the represented integer is
+	// -1-Uint.
+	Uint uint64
+
+	// Bytes holds the payload of a TypeBytes or TypeText item.
+	Bytes []byte
+
+	// Simple holds the CBOR simple value of a non-float TypeOther item:
+	// 20 is false, 21 is true, 22 is null, 23 is undefined, or else a raw
+	// simple(n).
+	Simple byte
+
+	// Float and IsFloat hold the value of a floating-point TypeOther
+	// item; IsFloat is false for a TypeOther item that isn't a float, in
+	// which case Simple is set instead.
+	Float   float64
+	IsFloat bool
+}
+
+// frame tracks progress through one array or map that's currently open.
+type frame struct {
+	typ       Type // TypeArray or TypeMap
+	remaining uint64
+	wantKey   bool            // only meaningful when typ == TypeMap
+	lastKey   []byte          // canonical encoding of the most recently seen key, for ordering
+	seenKeys  map[string]bool // canonical encodings of every key seen so far, for TypeMap
+}
+
+// Decoder reads a stream of CBOR data items from an io.Reader, reporting
+// each as an Event. It complements the cbor package's write side, and
+// rejects anything that isn't well-formed: out-of-range lengths, invalid
+// UTF-8 in text strings, and duplicate byte/text string map keys are all
+// reported as errors rather than passed through to the caller. Map keys of
+// other types are not checked for duplicates.
+type Decoder struct {
+	r *bufio.Reader
+
+	stack []*frame
+
+	// canonical stays true as long as every item decoded so far used its
+	// shortest encoding and every map's (comparable) keys were sorted.
+	// Canonical reports this once decoding is complete.
+	canonical bool
+	done      bool
+}
+
+// NewDecoder returns a Decoder that reads CBOR data items from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r), canonical: true}
+}
+
+// Canonical reports whether every item Next has returned so far was encoded
+// in canonical CBOR (RFC 7049 §3.9): every integer, length, and tag used
+// its shortest form, and every map's string-keyed pairs were written in
+// sorted order. It mirrors the rules Encoded and encodedSize apply on the
+// write side, so callers can share one canonicality check between encoding
+// and decoding. Call it only after Next has returned io.EOF.
+func (d *Decoder) Canonical() bool {
+	if !d.done {
+		panic("cbor: Canonical called before the top-level item finished decoding")
+	}
+	return d.canonical
+}
+
+// Reset prepares d to decode another top-level item from the same
+// underlying reader, picking up wherever the previous item's bytes ended.
+// Call it after Next has returned io.EOF, before decoding the next item in
+// a stream framing several CBOR items back to back, e.g. gen-signedexchange's
+// signer daemon reading one frame at a time off a persistent connection.
+func (d *Decoder) Reset() {
+	d.stack = nil
+	d.canonical = true
+	d.done = false
+}
+
+func (d *Decoder) top() *frame {
+	if len(d.stack) == 0 {
+		return nil
+	}
+	return d.stack[len(d.stack)-1]
+}
+
+func (d *Decoder) readByte() (byte, error) {
+	return d.r.ReadByte()
+}
+
+func (d *Decoder) readN(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// readLength decodes the length/value bytes following ai in an item's
+// initial byte, returning the decoded value and the total number of bytes
+// the initial byte plus any length bytes occupied.
+func (d *Decoder) readLength(ai byte) (uint64, int, error) {
+	switch {
+	case ai < 24:
+		return uint64(ai), 1, nil
+	case ai == 24:
+		bs, err := d.readN(1)
+		if err != nil {
+			return 0, 0, err
+		}
+		return uint64(bs[0]), 2, nil
+	case ai == 25:
+		bs, err := d.readN(2)
+		if err != nil {
+			return 0, 0, err
+		}
+		return uint64(bs[0])<<8 | uint64(bs[1]), 3, nil
+	case ai == 26:
+		bs, err := d.readN(4)
+		if err != nil {
+			return 0, 0, err
+		}
+		return uint64(bs[0])<<24 | uint64(bs[1])<<16 | uint64(bs[2])<<8 | uint64(bs[3]), 5, nil
+	case ai == 27:
+		bs, err := d.readN(8)
+		if err != nil {
+			return 0, 0, err
+		}
+		var v uint64
+		for _, b := range bs {
+			v = v<<8 | uint64(b)
+		}
+		return v, 9, nil
+	case ai == 31:
+		return 0, 0, fmt.Errorf("cbor: indefinite-length items are not supported")
+	default:
+		return 0, 0, fmt.Errorf("cbor: reserved additional information %d in initial byte", ai)
+	}
+}
+
+func (d *Decoder) decodeOther(ai byte, ev *Event) error {
+	switch {
+	case ai < 24:
+		ev.Simple = ai
+	case ai == 24:
+		bs, err := d.readN(1)
+		if err != nil {
+			return err
+		}
+		if bs[0] < 32 {
+			return fmt.Errorf("cbor: simple value %d must be encoded directly, not with an extra byte", bs[0])
+		}
+		ev.Simple = bs[0]
+	case ai == 25:
+		bs, err := d.readN(2)
+		if err != nil {
+			return err
+		}
+		ev.Float = float64(math.Float32frombits(halfToFloat32Bits(uint16(bs[0])<<8 | uint16(bs[1]))))
+		ev.IsFloat = true
+	case ai == 26:
+		bs, err := d.readN(4)
+		if err != nil {
+			return err
+		}
+		ev.Float = float64(math.Float32frombits(binary.BigEndian.Uint32(bs)))
+		ev.IsFloat = true
+	case ai == 27:
+		bs, err := d.readN(8)
+		if err != nil {
+			return err
+		}
+		ev.Float = math.Float64frombits(binary.BigEndian.Uint64(bs))
+		ev.IsFloat = true
+	case ai == 31:
+		return fmt.Errorf("cbor: unexpected break outside an indefinite-length item")
+	default:
+		return fmt.Errorf("cbor: reserved additional information %d in initial byte", ai)
+	}
+	return nil
+}
+
+// checkMapKey enforces RFC 7049 §3.9 duplicate-key rejection and tracks
+// canonical ordering for map keys whose canonical encoding is comparable
+// (byte and text string keys); other key types are accepted without a
+// duplicate or ordering check. Duplicate rejection compares key against
+// every key seen so far in this map, not just the immediately preceding
+// one, since a non-canonical (but otherwise well-formed) map can repeat a
+// key anywhere, not just adjacently.
+func (d *Decoder) checkMapKey(f *frame, key []byte) error {
+	if f.seenKeys == nil {
+		f.seenKeys = make(map[string]bool)
+	}
+	if f.seenKeys[string(key)] {
+		return fmt.Errorf("cbor: duplicate map key %x", key)
+	}
+	f.seenKeys[string(key)] = true
+	if f.lastKey != nil && !canonicalKeyLess(f.lastKey, key) {
+		d.canonical = false
+	}
+	f.lastKey = key
+	return nil
+}
+
+// canonicalKeyLess reports whether encoded map key a sorts before b under
+// RFC 7049 §3.9 canonical CBOR ordering: shorter encodings first, then
+// lexicographically by byte value.
+func canonicalKeyLess(a, b []byte) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return bytes.Compare(a, b) < 0
+}
+
+// closeElement records that the item most recently fully read (a leaf, or
+// a container whose End event was just emitted) completes one element of
+// the innermost enclosing array or map, if any. keyBytes is the item's
+// canonical encoding when it was read in a map's key position and its type
+// supports an ordering check; it's nil otherwise.
+func (d *Decoder) closeElement(keyBytes []byte) error {
+	f := d.top()
+	if f == nil {
+		// A top-level leaf is the whole top-level item.
+		d.done = true
+		return nil
+	}
+	if f.typ == TypeMap && f.wantKey && keyBytes != nil {
+		if err := d.checkMapKey(f, keyBytes); err != nil {
+			return err
+		}
+	}
+	f.remaining--
+	if f.typ == TypeMap {
+		f.wantKey = !f.wantKey
+	}
+	return nil
+}
+
+// Next decodes and returns the next Event in the stream: a new data item,
+// or the End of an array/map opened by an earlier event. It returns io.EOF
+// once the top-level item (and everything nested inside it) has been
+// fully read; any truncation before that point is reported as a distinct,
+// non-EOF error.
+func (d *Decoder) Next() (*Event, error) {
+	if d.done {
+		return nil, io.EOF
+	}
+
+	if f := d.top(); f != nil && f.remaining == 0 {
+		d.stack = d.stack[:len(d.stack)-1]
+		ev := &Event{Type: f.typ, End: true}
+		if len(d.stack) == 0 {
+			d.done = true
+		} else if err := d.closeElement(nil); err != nil {
+			return nil, err
+		}
+		return ev, nil
+	}
+
+	var tags []uint64
+	var t Type
+	var ai byte
+	for {
+		b, err := d.readByte()
+		if err != nil {
+			if err == io.EOF {
+				if len(tags) > 0 || len(d.stack) > 0 {
+					return nil, fmt.Errorf("cbor: unexpected end of input")
+				}
+				d.done = true
+			}
+			return nil, err
+		}
+		t = Type(b & 0xe0)
+		ai = b & 0x1f
+		if t != TypeTag {
+			break
+		}
+		v, hlen, err := d.readLength(ai)
+		if err != nil {
+			return nil, err
+		}
+		if hlen-1 != encodedSize(v) {
+			d.canonical = false
+		}
+		tags = append(tags, v)
+	}
+
+	ev := &Event{Type: t, Tags: tags}
+	switch t {
+	case TypeOther:
+		if err := d.decodeOther(ai, ev); err != nil {
+			return nil, err
+		}
+		if err := d.closeElement(nil); err != nil {
+			return nil, err
+		}
+
+	case TypePosInt, TypeNegInt:
+		v, hlen, err := d.readLength(ai)
+		if err != nil {
+			return nil, err
+		}
+		if hlen-1 != encodedSize(v) {
+			d.canonical = false
+		}
+		ev.Uint = v
+		if err := d.closeElement(nil); err != nil {
+			return nil, err
+		}
+
+	case TypeBytes, TypeText:
+		n, hlen, err := d.readLength(ai)
+		if err != nil {
+			return nil, err
+		}
+		if hlen-1 != encodedSize(n) {
+			d.canonical = false
+		}
+		if n > maxItemLength {
+			return nil, fmt.Errorf("cbor: item length %d exceeds the %d-byte limit", n, maxItemLength)
+		}
+		payload, err := d.readN(int(n))
+		if err != nil {
+			return nil, err
+		}
+		if t == TypeText && !utf8.Valid(payload) {
+			return nil, fmt.Errorf("cbor: invalid UTF-8 in text string %q", payload)
+		}
+		ev.Bytes = payload
+		var keyBytes []byte
+		if f := d.top(); f != nil && f.typ == TypeMap && f.wantKey {
+			keyBytes = append(Encoded(t, len(payload)), payload...)
+		}
+		if err := d.closeElement(keyBytes); err != nil {
+			return nil, err
+		}
+
+	case TypeArray, TypeMap:
+		n, hlen, err := d.readLength(ai)
+		if err != nil {
+			return nil, err
+		}
+		if hlen-1 != encodedSize(n) {
+			d.canonical = false
+		}
+		ev.Uint = n
+		remaining := n
+		if t == TypeMap {
+			remaining *= 2
+		}
+		d.stack = append(d.stack, &frame{typ: t, remaining: remaining, wantKey: t == TypeMap})
+
+	default:
+		return nil, fmt.Errorf("cbor: unexpected major type %#x in initial byte", byte(t))
+	}
+
+	return ev, nil
+}
+
+// halfToFloat32Bits converts an IEEE 754 half-precision (binary16) value to
+// the bit pattern of the equivalent float32, for decoding CBOR's 2-byte
+// floating-point major-type-7 items.
+func halfToFloat32Bits(h uint16) uint32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h&0x7c00) >> 10
+	frac := uint32(h & 0x03ff)
+
+	switch exp {
+	case 0:
+		if frac == 0 {
+			return sign
+		}
+		shift := uint32(0)
+		for frac&0x0400 == 0 {
+			frac <<= 1
+			shift++
+		}
+		frac &= 0x03ff
+		return sign | (127-15-shift+1)<<23 | frac<<13
+	case 0x1f:
+		if frac == 0 {
+			return sign | 0x7f800000
+		}
+		return sign | 0x7fc00000 | frac<<13
+	default:
+		return sign | (exp+(127-15))<<23 | frac<<13
+	}
+}
+
+// Header describes one CBOR data item located within a ReaderAt by Parse,
+// giving its type, decoded value, and the exact byte range its header and
+// payload occupy, so callers can re-read the raw bytes (e.g. to pull an
+// embedded OCSP response out of a cert-chain item) without re-encoding
+// anything or holding the whole input in memory.
+type Header struct {
+	Type Type
+	// Uint holds the decoded value for TypePosInt/TypeNegInt, or the
+	// element count for TypeArray/TypeMap.
+	Uint uint64
+	// Tags holds any tag numbers wrapping this item, outermost first.
+	Tags []uint64
+
+	// Offset is the absolute offset of this item's first byte within the
+	// ReaderAt passed to Parse; for a tagged item, that is the first byte
+	// of its outermost tag.
+	Offset int64
+	// HeaderLen is the size in bytes of the item's own initial byte and any
+	// length bytes that follow it, not counting any tags.
+	HeaderLen int64
+	// PayloadOffset and PayloadLen locate the raw bytes of a TypeBytes or
+	// TypeText item; they're zero for other types.
+	PayloadOffset int64
+	PayloadLen    int64
+
+	// Children holds the parsed sub-items of a TypeArray or TypeMap, in
+	// wire order (a map's keys and values are interleaved, as on the
+	// wire).
+	Children []*Header
+	// KeysSorted is true unless Type is TypeMap and a byte/text key was
+	// found out of canonical order; it's meaningless for non-map types.
+	// Checking it recursively is what Canonical does.
+	KeysSorted bool
+}
+
+// Canonical reports whether h and everything beneath it is encoded in
+// canonical CBOR (RFC 7049 §3.9): every integer and length uses its
+// shortest possible form, and every map's string-keyed pairs are sorted.
+// It mirrors the checks Decoder.Canonical makes, for a tree obtained via
+// Parse instead of a streaming decode, except that the encoding of tag
+// numbers is not checked.
+func (h *Header) Canonical() bool {
+	switch h.Type {
+	case TypePosInt, TypeNegInt, TypeTag, TypeArray, TypeMap:
+		if h.HeaderLen != 1+int64(encodedSize(h.Uint)) {
+			return false
+		}
+	case TypeBytes, TypeText:
+		if h.HeaderLen != 1+int64(encodedSize(uint64(h.PayloadLen))) {
+			return false
+		}
+	}
+	if h.Type == TypeMap && !h.KeysSorted {
+		return false
+	}
+	for _, c := range h.Children {
+		if !c.Canonical() {
+			return false
+		}
+	}
+	return true
+}
+
+// parser implements Parse's random-access, non-copying walk over an
+// io.ReaderAt.
+type parser struct {
+	r   io.ReaderAt
+	off int64
+}
+
+// Parse reads the single CBOR data item starting at offset 0 of r and
+// returns its Header tree. It enforces the same well-formedness rules as
+// Decoder (lengths in range, valid UTF-8, no duplicate byte/text string map
+// keys), but doesn't keep bytes/text payloads in the tree (text payloads
+// are read once to check their UTF-8): callers fetch those with
+// r.ReadAt using the offsets recorded in the tree, which lets a verifier
+// validate a signed-exchange cert-chain's structure without re-encoding or
+// holding it whole.
+func Parse(r io.ReaderAt) (*Header, error) {
+	p := &parser{r: r}
+	return p.item()
+}
+
+func (p *parser) readByte() (byte, error) {
+	var b [1]byte
+	if _, err := p.r.ReadAt(b[:], p.off); err != nil {
+		return 0, err
+	}
+	p.off++
+	return b[0], nil
+}
+
+func (p *parser) readN(n int64) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := p.r.ReadAt(buf, p.off); err != nil {
+		return nil, err
+	}
+	p.off += n
+	return buf, nil
+}
+
+func (p *parser) readLength(ai byte) (uint64, int64, error) {
+	switch {
+	case ai < 24:
+		return uint64(ai), 1, nil
+	case ai == 24:
+		bs, err := p.readN(1)
+		if err != nil {
+			return 0, 0, err
+		}
+		return uint64(bs[0]), 2, nil
+	case ai == 25:
+		bs, err := p.readN(2)
+		if err != nil {
+			return 0, 0, err
+		}
+		return uint64(bs[0])<<8 | uint64(bs[1]), 3, nil
+	case ai == 26:
+		bs, err := p.readN(4)
+		if err != nil {
+			return 0, 0, err
+		}
+		return uint64(bs[0])<<24 | uint64(bs[1])<<16 | uint64(bs[2])<<8 | uint64(bs[3]), 5, nil
+	case ai == 27:
+		bs, err := p.readN(8)
+		if err != nil {
+			return 0, 0, err
+		}
+		var v uint64
+		for _, b := range bs {
+			v = v<<8 | uint64(b)
+		}
+		return v, 9, nil
+	case ai == 31:
+		return 0, 0, fmt.Errorf("cbor: indefinite-length items are not supported")
+	default:
+		return 0, 0, fmt.Errorf("cbor: reserved additional information %d in initial byte", ai)
+	}
+}
+
+func (p *parser) skipOther(ai byte) (int64, error) {
+	switch {
+	case ai < 24:
+		return 1, nil
+	case ai == 24:
+		if _, err := p.readN(1); err != nil {
+			return 0, err
+		}
+		return 2, nil
+	case ai == 25:
+		if _, err := p.readN(2); err != nil {
+			return 0, err
+		}
+		return 3, nil
+	case ai == 26:
+		if _, err := p.readN(4); err != nil {
+			return 0, err
+		}
+		return 5, nil
+	case ai == 27:
+		if _, err := p.readN(8); err != nil {
+			return 0, err
+		}
+		return 9, nil
+	case ai == 31:
+		return 0, fmt.Errorf("cbor: unexpected break outside an indefinite-length item")
+	default:
+		return 0, fmt.Errorf("cbor: reserved additional information %d in initial byte", ai)
+	}
+}
+
+// canonicalKeyBytes returns h's canonical encoding for use as a map-key
+// ordering/duplicate check, re-reading its payload through p since Header
+// doesn't retain one. Only byte and text string keys are comparable; ok is
+// false for any other key type.
+func (p *parser) canonicalKeyBytes(h *Header) (key []byte, ok bool) {
+	if h.Type != TypeBytes && h.Type != TypeText {
+		return nil, false
+	}
+	payload := make([]byte, h.PayloadLen)
+	if _, err := p.r.ReadAt(payload, h.PayloadOffset); err != nil {
+		return nil, false
+	}
+	return append(Encoded(h.Type, int(h.PayloadLen)), payload...), true
+}
+
+// item parses one data item (following any wrapping tags) starting at the
+// parser's current offset, recursing into arrays and maps.
+func (p *parser) item() (*Header, error) {
+	startOffset := p.off
+	var tags []uint64
+	var t Type
+	var ai byte
+	for {
+		b, err := p.readByte()
+		if err != nil {
+			return nil, err
+		}
+		t = Type(b & 0xe0)
+		ai = b & 0x1f
+		if t != TypeTag {
+			break
+		}
+		v, _, err := p.readLength(ai)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, v)
+	}
+
+	switch t {
+	case TypeOther:
+		hlen, err := p.skipOther(ai)
+		if err != nil {
+			return nil, err
+		}
+		return &Header{Type: t, Tags: tags, Offset: startOffset, HeaderLen: hlen, KeysSorted: true}, nil
+
+	case TypePosInt, TypeNegInt:
+		v, hlen, err := p.readLength(ai)
+		if err != nil {
+			return nil, err
+		}
+		return &Header{Type: t, Uint: v, Tags: tags, Offset: startOffset, HeaderLen: hlen, KeysSorted: true}, nil
+
+	case TypeBytes, TypeText:
+		n, hlen, err := p.readLength(ai)
+		if err != nil {
+			return nil, err
+		}
+		if n > maxItemLength {
+			return nil, fmt.Errorf("cbor: item length %d exceeds the %d-byte limit", n, maxItemLength)
+		}
+		payloadOffset := p.off
+		if t == TypeText && n > 0 {
+			bs, err := p.readN(int64(n))
+			if err != nil {
+				return nil, err
+			}
+			if !utf8.Valid(bs) {
+				return nil, fmt.Errorf("cbor: invalid UTF-8 in text string at offset %d", payloadOffset)
+			}
+		} else if n > 0 {
+			if _, err := p.r.ReadAt(make([]byte, 1), payloadOffset+int64(n)-1); err != nil {
+				return nil, fmt.Errorf("cbor: truncated bytes payload at offset %d: %v", payloadOffset, err)
+			}
+			p.off = payloadOffset + int64(n)
+		}
+		return &Header{
+			Type: t, Uint: n, Tags: tags, Offset: startOffset, HeaderLen: hlen,
+			PayloadOffset: payloadOffset, PayloadLen: int64(n), KeysSorted: true,
+		}, nil
+
+	case TypeArray, TypeMap:
+		n, hlen, err := p.readLength(ai)
+		if err != nil {
+			return nil, err
+		}
+		count := n
+		if t == TypeMap {
+			count *= 2
+		}
+		// count comes straight from the wire and is not bounded against the
+		// remaining input, so children must grow as items are actually
+		// parsed rather than being preallocated to count's capacity: a
+		// truncated input could otherwise claim an enormous count and make
+		// this a quick way to exhaust memory (or, for a count near 2^64,
+		// panic make with "cap out of range").
+		var children []*Header
+		keysSorted := true
+		var lastKey []byte
+		seenKeys := map[string]bool{}
+		for i := uint64(0); i < count; i++ {
+			child, err := p.item()
+			if err != nil {
+				return nil, err
+			}
+			if t == TypeMap && i%2 == 0 {
+				if key, ok := p.canonicalKeyBytes(child); ok {
+					if seenKeys[string(key)] {
+						return nil, fmt.Errorf("cbor: duplicate map key at offset %d", child.Offset)
+					}
+					seenKeys[string(key)] = true
+					if lastKey != nil && !canonicalKeyLess(lastKey, key) {
+						keysSorted = false
+					}
+					lastKey = key
+				}
+			}
+			children = append(children, child)
+		}
+		return &Header{
+			Type: t, Uint: n, Tags: tags, Offset: startOffset, HeaderLen: hlen,
+			Children: children, KeysSorted: keysSorted,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("cbor: unexpected major type %#x in initial byte", byte(t))
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"sort"
 	"unicode/utf8"
 )
 
@@ -56,6 +57,10 @@ type item struct {
 	activeChild *item
 	// The byte offset within the buffer at which this item starts.
 	startOffset uint64
+	// The TopLevel this item was (possibly transitively) appended to,
+	// shared by every item in the tree so any of them can check
+	// TopLevel.Canonical.
+	root *TopLevel
 }
 type compoundItem struct {
 	item
@@ -65,6 +70,13 @@ type compoundItem struct {
 
 type TopLevel struct {
 	compoundItem
+
+	// Canonical, if true, forbids indefinite-length arrays, maps, byte
+	// strings, and text strings anywhere in this item tree. Signed-exchange
+	// signatures are computed over a deterministic (canonical) CBOR
+	// encoding, which has no use for streaming forms, so producers of that
+	// encoding should set this before appending anything.
+	Canonical bool
 }
 
 // New returns a new CBOR top-level item for the caller to write into. Call
@@ -72,9 +84,18 @@ type TopLevel struct {
 func New(to io.Writer) *TopLevel {
 	result := &TopLevel{}
 	result.countingWriter = newCountingWriter(to)
+	result.root = result
 	return result
 }
 
+// checkIndefiniteAllowed panics if it belongs to a TopLevel marked
+// Canonical, which forbids indefinite-length items.
+func (it *item) checkIndefiniteAllowed() {
+	if it.root.Canonical {
+		panic("Cannot write an indefinite-length item to a canonical TopLevel.")
+	}
+}
+
 // Finish checks for well-formed-ness and flushes the serialization to the
 // Writer passed to New.
 func (c *TopLevel) Finish() error {
@@ -187,6 +208,7 @@ func (ci *compoundItem) AppendBytesWriter(n int64) *BytesWriter {
 			countingWriter: ci.countingWriter,
 			parent:         ci,
 			startOffset:    ci.bytes,
+			root:           ci.root,
 		},
 		remainingSize: n,
 	}
@@ -220,6 +242,10 @@ func (ci *compoundItem) AppendSerializedItem(r io.Reader) {
 type Array struct {
 	compoundItem
 	expectedSize uint64
+	// indefinite is true for an Array opened with AppendIndefiniteArray,
+	// whose size wasn't known upfront; Finish writes a break byte instead
+	// of checking elements against expectedSize.
+	indefinite bool
 }
 
 func (ci *compoundItem) AppendArray(expectedSize uint64) *Array {
@@ -231,6 +257,7 @@ func (ci *compoundItem) AppendArray(expectedSize uint64) *Array {
 				countingWriter: ci.countingWriter,
 				parent:         ci,
 				startOffset:    startOffset,
+				root:           ci.root,
 			},
 			elements: 0,
 		},
@@ -240,12 +267,39 @@ func (ci *compoundItem) AppendArray(expectedSize uint64) *Array {
 	return a
 }
 
+// AppendIndefiniteArray opens an array whose element count isn't known
+// until the caller is done appending to it, e.g. because it's being filled
+// from a stream. Call Finish when done; it writes the CBOR break byte
+// instead of checking the element count against an expected size.
+// AppendIndefiniteArray panics if its TopLevel is marked Canonical.
+func (ci *compoundItem) AppendIndefiniteArray() *Array {
+	ci.checkIndefiniteAllowed()
+	ci.elements++
+	startOffset := ci.bytes
+	ci.Write([]byte{0x9f})
+	a := &Array{
+		compoundItem: compoundItem{
+			item: item{
+				countingWriter: ci.countingWriter,
+				parent:         ci,
+				startOffset:    startOffset,
+				root:           ci.root,
+			},
+		},
+		indefinite: true,
+	}
+	ci.activeChild = &a.item
+	return a
+}
+
 func (a *Array) Finish() {
 	if a.activeChild != nil {
 		panic(fmt.Sprintf("Must finish child %v before its parent %v.",
 			a.activeChild, a))
 	}
-	if a.elements != a.expectedSize {
+	if a.indefinite {
+		a.Write([]byte{0xff})
+	} else if a.elements != a.expectedSize {
 		panic(fmt.Sprintf("Array has size %v but was initialized with size %v",
 			a.elements, a.expectedSize))
 	}
@@ -256,6 +310,9 @@ func (a *Array) Finish() {
 type Map struct {
 	compoundItem
 	expectedSize uint64
+	// indefinite is true for a Map opened with AppendIndefiniteMap; see
+	// Array.indefinite.
+	indefinite bool
 }
 
 func (ci *compoundItem) AppendMap(expectedSize uint64) *Map {
@@ -267,6 +324,7 @@ func (ci *compoundItem) AppendMap(expectedSize uint64) *Map {
 				countingWriter: ci.countingWriter,
 				parent:         ci,
 				startOffset:    startOffset,
+				root:           ci.root,
 			},
 			elements: 0,
 		},
@@ -276,6 +334,29 @@ func (ci *compoundItem) AppendMap(expectedSize uint64) *Map {
 	return m
 }
 
+// AppendIndefiniteMap is to AppendMap as AppendIndefiniteArray is to
+// AppendArray: it opens a map whose key/value pair count isn't known
+// upfront. AppendIndefiniteMap panics if its TopLevel is marked Canonical.
+func (ci *compoundItem) AppendIndefiniteMap() *Map {
+	ci.checkIndefiniteAllowed()
+	ci.elements++
+	startOffset := ci.bytes
+	ci.Write([]byte{0xbf})
+	m := &Map{
+		compoundItem: compoundItem{
+			item: item{
+				countingWriter: ci.countingWriter,
+				parent:         ci,
+				startOffset:    startOffset,
+				root:           ci.root,
+			},
+		},
+		indefinite: true,
+	}
+	ci.activeChild = &m.item
+	return m
+}
+
 func (m *Map) Finish() {
 	if m.activeChild != nil {
 		panic(fmt.Sprintf("Must finish child %v before its parent %v.",
@@ -284,10 +365,205 @@ func (m *Map) Finish() {
 	if m.elements%2 != 0 {
 		panic("Map's last key is missing a value.")
 	}
-	if m.elements != m.expectedSize*2 {
+	if m.indefinite {
+		m.Write([]byte{0xff})
+	} else if m.elements != m.expectedSize*2 {
 		panic(fmt.Sprintf("Map has size %v but was initialized with size %v",
 			m.elements/2, m.expectedSize))
 	}
 	m.parent.activeChild = nil
 	m.countingWriter = nil
 }
+
+// IndefiniteBytes lets the caller stream a CBOR byte string as a sequence
+// of definite-length chunks, without knowing the total size upfront.
+type IndefiniteBytes struct {
+	compoundItem
+}
+
+// AppendIndefiniteBytes opens a byte string to be filled in with one or
+// more chunks via AppendChunk; call Finish when done. AppendIndefiniteBytes
+// panics if its TopLevel is marked Canonical.
+func (ci *compoundItem) AppendIndefiniteBytes() *IndefiniteBytes {
+	ci.checkIndefiniteAllowed()
+	ci.elements++
+	startOffset := ci.bytes
+	ci.Write([]byte{0x5f})
+	b := &IndefiniteBytes{
+		compoundItem: compoundItem{
+			item: item{
+				countingWriter: ci.countingWriter,
+				parent:         ci,
+				startOffset:    startOffset,
+				root:           ci.root,
+			},
+		},
+	}
+	ci.activeChild = &b.item
+	return b
+}
+
+// AppendChunk appends one definite-length chunk of the byte string.
+func (b *IndefiniteBytes) AppendChunk(bs []byte) {
+	b.encodeInt(TypeBytes, len(bs))
+	b.Write(bs)
+}
+
+func (b *IndefiniteBytes) Finish() {
+	if b.activeChild != nil {
+		panic(fmt.Sprintf("Must finish child %v before its parent %v.",
+			b.activeChild, b))
+	}
+	b.Write([]byte{0xff})
+	b.parent.activeChild = nil
+	b.countingWriter = nil
+}
+
+// IndefiniteUTF8 is to AppendIndefiniteBytes/IndefiniteBytes as AppendUTF8
+// is to AppendBytes: it streams a CBOR text string as a sequence of
+// definite-length chunks, each individually checked for valid UTF-8.
+type IndefiniteUTF8 struct {
+	compoundItem
+}
+
+// AppendIndefiniteUTF8 opens a text string to be filled in with one or more
+// chunks via AppendChunk; call Finish when done. AppendIndefiniteUTF8
+// panics if its TopLevel is marked Canonical.
+func (ci *compoundItem) AppendIndefiniteUTF8() *IndefiniteUTF8 {
+	ci.checkIndefiniteAllowed()
+	ci.elements++
+	startOffset := ci.bytes
+	ci.Write([]byte{0x7f})
+	u := &IndefiniteUTF8{
+		compoundItem: compoundItem{
+			item: item{
+				countingWriter: ci.countingWriter,
+				parent:         ci,
+				startOffset:    startOffset,
+				root:           ci.root,
+			},
+		},
+	}
+	ci.activeChild = &u.item
+	return u
+}
+
+// AppendChunk checks that bs holds valid UTF-8 and appends it as one chunk
+// of the text string.
+func (u *IndefiniteUTF8) AppendChunk(bs []byte) {
+	if !utf8.Valid(bs) {
+		panic(fmt.Sprintf("Invalid UTF-8 in %q.", bs))
+	}
+	u.encodeInt(TypeText, len(bs))
+	u.Write(bs)
+}
+
+func (u *IndefiniteUTF8) AppendChunkS(str string) {
+	u.AppendChunk([]byte(str))
+}
+
+func (u *IndefiniteUTF8) Finish() {
+	if u.activeChild != nil {
+		panic(fmt.Sprintf("Must finish child %v before its parent %v.",
+			u.activeChild, u))
+	}
+	u.Write([]byte{0xff})
+	u.parent.activeChild = nil
+	u.countingWriter = nil
+}
+
+// canonicalMapEntry is one buffered key/value pair of a CanonicalMap,
+// awaiting Finish to decide where it falls in canonical key order.
+type canonicalMapEntry struct {
+	// keyEncoded is key's own CBOR encoding (the same bytes
+	// Decoder.checkMapKey would compute from it), which is what canonical
+	// order and duplicate rejection are based on.
+	keyEncoded []byte
+	key        string
+	value      []byte
+}
+
+// CanonicalMap builds a map whose string keys and byte-string values are
+// written out in RFC 7049 §3.9 canonical key order (shortest encoded key
+// first, then lexicographic) at Finish, regardless of the order AppendEntry
+// was called in, and rejects duplicate keys. This lets a producer of
+// deterministic CBOR, like gen-signedexchange's cert-chain writer, hand over
+// key/value pairs as it happens to have them instead of pre-sorting them.
+type CanonicalMap struct {
+	compoundItem
+	expectedSize uint64
+	entries      []canonicalMapEntry
+}
+
+// AppendCanonicalMap opens a CanonicalMap of expectedSize key/value pairs.
+// Call AppendEntry once per pair, then Finish.
+func (ci *compoundItem) AppendCanonicalMap(expectedSize uint64) *CanonicalMap {
+	ci.elements++
+	startOffset := ci.bytes
+	m := &CanonicalMap{
+		compoundItem: compoundItem{
+			item: item{
+				countingWriter: ci.countingWriter,
+				parent:         ci,
+				startOffset:    startOffset,
+				root:           ci.root,
+			},
+		},
+		expectedSize: expectedSize,
+	}
+	ci.activeChild = &m.item
+	return m
+}
+
+// AppendEntry buffers one key/value pair of the map; its value isn't
+// written to the underlying output until Finish places it in canonical
+// order.
+func (m *CanonicalMap) AppendEntry(key string, value []byte) {
+	m.entries = append(m.entries, canonicalMapEntry{
+		keyEncoded: append(Encoded(TypeText, len(key)), key...),
+		key:        key,
+		value:      value,
+	})
+}
+
+// AppendCanonicalMapBytes is AppendCanonicalMap, AppendEntry for each pair,
+// and Finish, in one call, for the common case of a map already available
+// as a Go map[string][]byte.
+func (ci *compoundItem) AppendCanonicalMapBytes(entries map[string][]byte) {
+	m := ci.AppendCanonicalMap(uint64(len(entries)))
+	for k, v := range entries {
+		m.AppendEntry(k, v)
+	}
+	m.Finish()
+}
+
+// Finish sorts the map's buffered entries into canonical key order, panics
+// if any two entries share a key or the entry count doesn't match the size
+// the map was opened with, and writes the map header and entries to the
+// underlying output.
+func (m *CanonicalMap) Finish() {
+	if m.activeChild != nil {
+		panic(fmt.Sprintf("Must finish child %v before its parent %v.",
+			m.activeChild, m))
+	}
+	if uint64(len(m.entries)) != m.expectedSize {
+		panic(fmt.Sprintf("CanonicalMap has size %v but was initialized with size %v",
+			len(m.entries), m.expectedSize))
+	}
+	sort.Slice(m.entries, func(i, j int) bool {
+		return canonicalKeyLess(m.entries[i].keyEncoded, m.entries[j].keyEncoded)
+	})
+	for i := 1; i < len(m.entries); i++ {
+		if bytes.Equal(m.entries[i-1].keyEncoded, m.entries[i].keyEncoded) {
+			panic(fmt.Sprintf("CanonicalMap has duplicate key %q", m.entries[i].key))
+		}
+	}
+
+	m.encodeInt64(TypeMap, m.expectedSize)
+	for _, e := range m.entries {
+		m.AppendUTF8S(e.key)
+		m.AppendBytes(e.value)
+	}
+	m.parent.activeChild = nil
+	m.countingWriter = nil
+}